@@ -0,0 +1,45 @@
+// +build !windows
+
+package edit
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// watchResize installs a SIGWINCH handler and, on receipt, invalidates w so
+// the next refresh does a full redraw at the new width, then notifies
+// redraw. redraw is buffered by one so a resize that arrives while the main
+// loop is busy is not lost, but a burst of resizes only triggers one pending
+// redraw; the main editor loop is expected to select on redraw alongside its
+// other event sources and call refresh(lastBufferState) when it fires,
+// since w and bufferState are not safe to touch from this goroutine.
+//
+// The returned function stops the handler and must be called to release the
+// signal.Notify registration.
+func watchResize(w *writer, redraw chan<- struct{}) (stop func()) {
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, syscall.SIGWINCH)
+	done := make(chan struct{})
+
+	go func() {
+		for {
+			select {
+			case <-sigCh:
+				w.Invalidate()
+				select {
+				case redraw <- struct{}{}:
+				default:
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	return func() {
+		signal.Stop(sigCh)
+		close(done)
+	}
+}
@@ -0,0 +1,122 @@
+// +build !windows
+
+package edit
+
+import (
+	"os"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// termCall records a single method call made against fakeTerminal, so tests
+// can assert on the exact sequence of cursor moves and writes a refresh
+// produced instead of just the rendered text.
+type termCall struct {
+	op     string
+	dx, dy int
+	col    int
+}
+
+// fakeTerminal is a Terminal that only records calls; it never formats an
+// escape sequence or touches a real screen, which is all writer_test-style
+// assertions about cursor math and rewritten content need.
+type fakeTerminal struct {
+	width, height int
+	calls         []termCall
+	written       []rune
+}
+
+func (t *fakeTerminal) WindowWidth() int  { return t.width }
+func (t *fakeTerminal) WindowHeight() int { return t.height }
+func (t *fakeTerminal) MoveCursor(dx, dy int) {
+	t.calls = append(t.calls, termCall{op: "move", dx: dx, dy: dy})
+}
+func (t *fakeTerminal) MoveToColumn(col int) {
+	t.calls = append(t.calls, termCall{op: "col", col: col})
+}
+func (t *fakeTerminal) ClearToEOL()      { t.calls = append(t.calls, termCall{op: "eol"}) }
+func (t *fakeTerminal) ClearToEOS()      { t.calls = append(t.calls, termCall{op: "eos"}) }
+func (t *fakeTerminal) SetStyle(s Style) {}
+func (t *fakeTerminal) HideCursor(hide bool) {}
+func (t *fakeTerminal) WriteRunes(rs ...rune) {
+	t.calls = append(t.calls, termCall{op: "write"})
+	t.written = append(t.written, rs...)
+}
+func (t *fakeTerminal) Flush() error { return nil }
+
+// firstMoveDy returns the dy of the first "move" call recorded, which is what
+// commitBuffer emits to reposition the terminal's real cursor relative to
+// the line it believes the cursor is on.
+func firstMoveDy(calls []termCall) (int, bool) {
+	for _, c := range calls {
+		if c.op == "move" {
+			return c.dy, true
+		}
+	}
+	return 0, false
+}
+
+func TestInvalidatePreservesDot(t *testing.T) {
+	w := &writer{term: &fakeTerminal{width: 20, height: 24}, oldBuf: newBuffer(0)}
+	bs := &bufferState{prompt: "a\nb\nprompt> ", mode: ModeInsert}
+	if err := w.refresh(bs); err != nil {
+		t.Fatalf("refresh: %v", err)
+	}
+	dot := w.oldBuf.dot
+	if dot.line == 0 {
+		t.Fatalf("test prompt should have left dot past line 0, got %+v", dot)
+	}
+
+	w.Invalidate()
+
+	if len(w.oldBuf.cells) != 1 || len(w.oldBuf.cells[0]) != 0 {
+		t.Fatalf("Invalidate should reset cells to a single empty line, got %+v", w.oldBuf.cells)
+	}
+	if w.oldBuf.dot != dot {
+		t.Fatalf("Invalidate should preserve dot %+v, got %+v", dot, w.oldBuf.dot)
+	}
+}
+
+// TestWatchResizeForcesFullRewrite fakes a resize by signalling this process
+// with SIGWINCH -- the same path watchResize installs a real handler for --
+// and asserts that the redraw it triggers first moves the cursor up from the
+// real last-known position (rather than from the buffer origin) to the top of
+// the buffer before repainting, which is only possible if Invalidate
+// preserved dot.
+func TestWatchResizeForcesFullRewrite(t *testing.T) {
+	term := &fakeTerminal{width: 20, height: 24}
+	w := &writer{term: term, oldBuf: newBuffer(0)}
+	bs := &bufferState{prompt: "a\nb\nprompt> ", mode: ModeInsert}
+	if err := w.refresh(bs); err != nil {
+		t.Fatalf("refresh: %v", err)
+	}
+	dot := w.oldBuf.dot
+	term.calls = nil
+	term.written = nil
+
+	redraw := make(chan struct{}, 1)
+	stop := watchResize(w, redraw)
+	defer stop()
+
+	if err := syscall.Kill(os.Getpid(), syscall.SIGWINCH); err != nil {
+		t.Fatalf("Kill: %v", err)
+	}
+
+	select {
+	case <-redraw:
+	case <-time.After(time.Second):
+		t.Fatal("watchResize did not notify redraw after SIGWINCH")
+	}
+
+	if err := w.refresh(bs); err != nil {
+		t.Fatalf("refresh after resize: %v", err)
+	}
+
+	if len(term.written) == 0 {
+		t.Fatal("resize-triggered refresh did not rewrite any content")
+	}
+	if dy, ok := firstMoveDy(term.calls); !ok || dy != -dot.line {
+		t.Fatalf("first cursor move after resize should move up %d lines from the real last-known position, got dy=%d (ok=%v)", dot.line, dy, ok)
+	}
+}
@@ -0,0 +1,207 @@
+package edit
+
+import (
+	"fmt"
+)
+
+// NamedColor is one of the 16 standard ANSI terminal colors.
+type NamedColor byte
+
+const (
+	Black NamedColor = iota
+	Red
+	Green
+	Yellow
+	Blue
+	Magenta
+	Cyan
+	White
+	BrightBlack
+	BrightRed
+	BrightGreen
+	BrightYellow
+	BrightBlue
+	BrightMagenta
+	BrightCyan
+	BrightWhite
+)
+
+type colorKind byte
+
+const (
+	colorNone colorKind = iota
+	colorNamed
+	colorPalette
+	colorRGB
+)
+
+// Color is a terminal color: one of the 16 named colors, a palette index
+// into the 256-color cube, or a 24-bit RGB triple. The zero Color is not a
+// valid color on its own; it is only meaningful as the Fg/Bg of a Style that
+// does not set that color (see Style.hasFg/hasBg).
+type Color struct {
+	kind colorKind
+	named NamedColor
+	palette byte
+	r, g, b byte
+}
+
+// NamedColorOf returns the Color for one of the 16 standard colors.
+func NamedColorOf(c NamedColor) Color { return Color{kind: colorNamed, named: c} }
+
+// PaletteColor returns the Color for index i of the 256-color palette.
+func PaletteColor(i byte) Color { return Color{kind: colorPalette, palette: i} }
+
+// RGBColor returns the 24-bit true color (r, g, b).
+func RGBColor(r, g, b byte) Color { return Color{kind: colorRGB, r: r, g: g, b: b} }
+
+// Style describes how a cell's content should be rendered, replacing the
+// raw SGR attribute strings ("1;31" and the like) that used to be threaded
+// through cell.attr and the attrFor* tables. The zero Style renders in the
+// terminal's default colors and attributes.
+type Style struct {
+	hasFg, hasBg bool
+	Fg, Bg Color
+	Bold, Dim, Italic, Underlined, Reverse bool
+}
+
+// WithFg returns a Style that sets the foreground color to c and otherwise
+// matches the zero Style.
+func WithFg(c Color) Style { return Style{hasFg: true, Fg: c} }
+
+// WithBg returns a Style that sets the background color to c and otherwise
+// matches the zero Style.
+func WithBg(c Color) Style { return Style{hasBg: true, Bg: c} }
+
+// Merge layers other on top of s: a color or boolean attribute other sets
+// takes precedence over s's, while a color other leaves unset falls back to
+// s's. This replaces the old `attr + attrForCompleted`-style string
+// concatenation, which could produce invalid escape sequences when the two
+// operands both set conflicting parameters.
+func (s Style) Merge(other Style) Style {
+	result := s
+	if other.hasFg {
+		result.hasFg = true
+		result.Fg = other.Fg
+	}
+	if other.hasBg {
+		result.hasBg = true
+		result.Bg = other.Bg
+	}
+	result.Bold = result.Bold || other.Bold
+	result.Dim = result.Dim || other.Dim
+	result.Italic = result.Italic || other.Italic
+	result.Underlined = result.Underlined || other.Underlined
+	result.Reverse = result.Reverse || other.Reverse
+	return result
+}
+
+// colorCodes returns the SGR parameter codes for c, using base as the offset
+// for the 8 standard colors (30 for foreground, 40 for background) and
+// extBase for the 256-color/RGB extended forms (38 for foreground, 48 for
+// background).
+func colorCodes(c Color, base, extBase int) []string {
+	switch c.kind {
+	case colorNamed:
+		n := int(c.named)
+		if n < 8 {
+			return []string{fmt.Sprintf("%d", base+n)}
+		}
+		return []string{fmt.Sprintf("%d", base+60+n-8)}
+	case colorPalette:
+		return []string{fmt.Sprintf("%d", extBase), "5", fmt.Sprintf("%d", c.palette)}
+	case colorRGB:
+		return []string{
+			fmt.Sprintf("%d", extBase), "2",
+			fmt.Sprintf("%d", c.r), fmt.Sprintf("%d", c.g), fmt.Sprintf("%d", c.b),
+		}
+	default:
+		return nil
+	}
+}
+
+// intensity is the terminal's actual tri-state rendering of Bold/Dim: unlike
+// the other attributes, codes 1 (bold) and 2 (dim) share a single "normal"
+// reset code (22), so they cannot be toggled as independent booleans without
+// one clobbering the other.
+type intensity byte
+
+const (
+	intensityNormal intensity = iota
+	intensityBold
+	intensityDim
+)
+
+// intensityOf collapses a Style's Bold/Dim booleans to the tri-state the
+// terminal actually implements, with Bold taking precedence if both are set.
+func intensityOf(s Style) intensity {
+	switch {
+	case s.Bold:
+		return intensityBold
+	case s.Dim:
+		return intensityDim
+	default:
+		return intensityNormal
+	}
+}
+
+// styleDelta returns the SGR parameter codes needed to change the terminal's
+// rendering attribute from `from` to `to`, omitting codes for attributes
+// that are already correct. This is the one place that turns a Style into
+// wire format, so redundant "\033[m\033[<attr>m" churn (and the invalid
+// sequences that ad-hoc string concatenation used to produce) cannot
+// reappear elsewhere.
+func styleDelta(from, to Style) []string {
+	if to == (Style{}) {
+		if from == (Style{}) {
+			return nil
+		}
+		return []string{"0"}
+	}
+
+	var codes []string
+	toggle := func(was, is bool, onCode, offCode string) {
+		if was == is {
+			return
+		}
+		if is {
+			codes = append(codes, onCode)
+		} else {
+			codes = append(codes, offCode)
+		}
+	}
+	if fromIntensity, toIntensity := intensityOf(from), intensityOf(to); fromIntensity != toIntensity {
+		// Bold and Dim are not independent SGR bits: both reset through the
+		// shared "normal intensity" code 22, so turning one off and the
+		// other on must emit the reset before the new on-code, never the
+		// other way around.
+		if fromIntensity != intensityNormal {
+			codes = append(codes, "22")
+		}
+		switch toIntensity {
+		case intensityBold:
+			codes = append(codes, "1")
+		case intensityDim:
+			codes = append(codes, "2")
+		}
+	}
+	toggle(from.Italic, to.Italic, "3", "23")
+	toggle(from.Underlined, to.Underlined, "4", "24")
+	toggle(from.Reverse, to.Reverse, "7", "27")
+
+	if from.hasFg != to.hasFg || (to.hasFg && from.Fg != to.Fg) {
+		if to.hasFg {
+			codes = append(codes, colorCodes(to.Fg, 30, 38)...)
+		} else {
+			codes = append(codes, "39")
+		}
+	}
+	if from.hasBg != to.hasBg || (to.hasBg && from.Bg != to.Bg) {
+		if to.hasBg {
+			codes = append(codes, colorCodes(to.Bg, 40, 48)...)
+		} else {
+			codes = append(codes, "49")
+		}
+	}
+	return codes
+}
@@ -0,0 +1,33 @@
+package edit
+
+// Terminal abstracts over the platform-specific operations writer needs in
+// order to repaint the screen. Keeping this as an interface means the
+// delta-redraw logic in commitBuffer never formats an escape sequence (or,
+// on Windows, calls into the console API) itself, so a new platform only
+// needs a new implementation of this interface, not changes to the editor.
+type Terminal interface {
+	// WindowWidth returns the number of columns in the terminal.
+	WindowWidth() int
+	// WindowHeight returns the number of rows in the terminal.
+	WindowHeight() int
+	// MoveCursor moves the cursor dx columns and dy rows relative to its
+	// current position. Positive dy moves down and positive dx moves right.
+	MoveCursor(dx, dy int)
+	// MoveToColumn moves the cursor to the given zero-based absolute column
+	// on the current line, without changing the row.
+	MoveToColumn(col int)
+	// ClearToEOL erases from the cursor to the end of the current line.
+	ClearToEOL()
+	// ClearToEOS erases from the cursor to the end of the screen.
+	ClearToEOS()
+	// SetStyle changes the style used for subsequently written runes. The
+	// zero Style resets to the terminal's default rendering. Implementations
+	// should no-op when s is already the current style.
+	SetStyle(s Style)
+	// HideCursor shows or hides the terminal cursor.
+	HideCursor(hide bool)
+	// WriteRunes writes runes in the current attribute.
+	WriteRunes(rs ...rune)
+	// Flush writes out any output buffered by the calls above.
+	Flush() error
+}
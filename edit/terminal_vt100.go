@@ -0,0 +1,89 @@
+// +build !windows
+
+package edit
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"strings"
+	"./tty"
+)
+
+// vt100Terminal is the Terminal implementation for POSIX terminals. It
+// writes raw VT100/ANSI escape sequences, buffering them up until Flush is
+// called -- this is the behavior writer relied on directly before Terminal
+// was introduced.
+type vt100Terminal struct {
+	file *os.File
+	buf bytes.Buffer
+	style Style
+}
+
+func newTerminal(f *os.File) Terminal {
+	return &vt100Terminal{file: f}
+}
+
+func (t *vt100Terminal) WindowWidth() int {
+	return int(tty.GetWinsize(int(t.file.Fd())).Col)
+}
+
+func (t *vt100Terminal) WindowHeight() int {
+	return int(tty.GetWinsize(int(t.file.Fd())).Row)
+}
+
+func (t *vt100Terminal) MoveCursor(dx, dy int) {
+	if dy > 0 {
+		fmt.Fprintf(&t.buf, "\033[%dB", dy)
+	} else if dy < 0 {
+		fmt.Fprintf(&t.buf, "\033[%dA", -dy)
+	}
+	if dx > 0 {
+		fmt.Fprintf(&t.buf, "\033[%dC", dx)
+	} else if dx < 0 {
+		fmt.Fprintf(&t.buf, "\033[%dD", -dx)
+	}
+}
+
+func (t *vt100Terminal) MoveToColumn(col int) {
+	fmt.Fprintf(&t.buf, "\033[%dG", col + 1)
+}
+
+func (t *vt100Terminal) ClearToEOL() {
+	t.buf.WriteString("\033[K")
+}
+
+func (t *vt100Terminal) ClearToEOS() {
+	t.buf.WriteString("\033[J")
+}
+
+func (t *vt100Terminal) SetStyle(s Style) {
+	if s == t.style {
+		return
+	}
+	codes := styleDelta(t.style, s)
+	if len(codes) > 0 {
+		fmt.Fprintf(&t.buf, "\033[%sm", strings.Join(codes, ";"))
+	}
+	t.style = s
+}
+
+func (t *vt100Terminal) HideCursor(hide bool) {
+	if hide {
+		t.buf.WriteString("\033[?25l")
+	} else {
+		t.buf.WriteString("\033[?25h")
+	}
+}
+
+func (t *vt100Terminal) WriteRunes(rs ...rune) {
+	for _, r := range rs {
+		t.buf.WriteRune(r)
+	}
+}
+
+func (t *vt100Terminal) Flush() error {
+	_, err := t.file.Write(t.buf.Bytes())
+	t.buf.Reset()
+	return err
+}
@@ -0,0 +1,187 @@
+// +build windows
+
+package edit
+
+import (
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+var (
+	kernel32 = syscall.NewLazyDLL("kernel32.dll")
+	procGetConsoleScreenBufferInfo = kernel32.NewProc("GetConsoleScreenBufferInfo")
+	procSetConsoleCursorPosition = kernel32.NewProc("SetConsoleCursorPosition")
+	procSetConsoleTextAttribute = kernel32.NewProc("SetConsoleTextAttribute")
+	procFillConsoleOutputCharacter = kernel32.NewProc("FillConsoleOutputCharacterW")
+	procFillConsoleOutputAttribute = kernel32.NewProc("FillConsoleOutputAttribute")
+)
+
+type coord struct {
+	x, y int16
+}
+
+func (c coord) arg() uintptr {
+	return uintptr(uint32(uint16(c.y))<<16 | uint32(uint16(c.x)))
+}
+
+type smallRect struct {
+	left, top, right, bottom int16
+}
+
+type consoleScreenBufferInfo struct {
+	size coord
+	cursorPosition coord
+	attributes uint16
+	window smallRect
+	maximumWindowSize coord
+}
+
+const defaultConsoleAttr = uint16(0x07)
+
+// winTerminal is the Terminal implementation for the Windows console. Unlike
+// vt100Terminal it does not buffer escape sequences; it calls straight
+// through to the console API, which does not have an established notion of
+// batching writes.
+type winTerminal struct {
+	handle syscall.Handle
+	attr uint16
+}
+
+func newTerminal(f *os.File) Terminal {
+	return &winTerminal{handle: syscall.Handle(f.Fd()), attr: defaultConsoleAttr}
+}
+
+func (t *winTerminal) info() consoleScreenBufferInfo {
+	var info consoleScreenBufferInfo
+	procGetConsoleScreenBufferInfo.Call(uintptr(t.handle), uintptr(unsafe.Pointer(&info)))
+	return info
+}
+
+func (t *winTerminal) WindowWidth() int {
+	info := t.info()
+	return int(info.window.right - info.window.left + 1)
+}
+
+func (t *winTerminal) WindowHeight() int {
+	info := t.info()
+	return int(info.window.bottom - info.window.top + 1)
+}
+
+func (t *winTerminal) setCursor(c coord) {
+	procSetConsoleCursorPosition.Call(uintptr(t.handle), c.arg())
+}
+
+func (t *winTerminal) MoveCursor(dx, dy int) {
+	cur := t.info().cursorPosition
+	t.setCursor(coord{x: cur.x + int16(dx), y: cur.y + int16(dy)})
+}
+
+func (t *winTerminal) MoveToColumn(col int) {
+	cur := t.info().cursorPosition
+	t.setCursor(coord{x: int16(col), y: cur.y})
+}
+
+// fill writes ch and the current attribute into n cells starting at start.
+func (t *winTerminal) fill(start coord, ch uint16, n uint32) {
+	var written uint32
+	procFillConsoleOutputCharacter.Call(
+		uintptr(t.handle), uintptr(ch), uintptr(n), start.arg(), uintptr(unsafe.Pointer(&written)))
+	procFillConsoleOutputAttribute.Call(
+		uintptr(t.handle), uintptr(t.attr), uintptr(n), start.arg(), uintptr(unsafe.Pointer(&written)))
+}
+
+func (t *winTerminal) ClearToEOL() {
+	info := t.info()
+	t.fill(info.cursorPosition, ' ', uint32(info.size.x-info.cursorPosition.x))
+}
+
+func (t *winTerminal) ClearToEOS() {
+	info := t.info()
+	rowsBelow := uint32(info.size.y - info.cursorPosition.y - 1)
+	n := uint32(info.size.x-info.cursorPosition.x) + rowsBelow*uint32(info.size.x)
+	t.fill(info.cursorPosition, ' ', n)
+}
+
+const (
+	foregroundBlue = 0x0001
+	foregroundGreen = 0x0002
+	foregroundRed = 0x0004
+	foregroundIntensity = 0x0008
+	backgroundBlue = 0x0010
+	backgroundGreen = 0x0020
+	backgroundRed = 0x0040
+	backgroundIntensity = 0x0080
+	commonLvbReverseVideo = 0x4000
+)
+
+// namedConsoleColor maps a NamedColor onto the RGB bits of a Windows console
+// text attribute (i.e. shifted into the foreground nibble; callers shift
+// left by 4 for the background nibble).
+var namedConsoleColor = map[NamedColor]uint16{
+	Black: 0,
+	Red: foregroundRed,
+	Green: foregroundGreen,
+	Yellow: foregroundRed | foregroundGreen,
+	Blue: foregroundBlue,
+	Magenta: foregroundRed | foregroundBlue,
+	Cyan: foregroundGreen | foregroundBlue,
+	White: foregroundRed | foregroundGreen | foregroundBlue,
+}
+
+// styleToConsoleAttr maps a Style onto a Windows console text-attribute
+// bitmask. Colors that are not one of the 16 named colors (256-color palette
+// entries, 24-bit RGB) are not representable on the console and fall back to
+// the default color.
+func styleToConsoleAttr(s Style) uint16 {
+	attr := defaultConsoleAttr
+	if s.hasFg {
+		attr = attr&^0x000f | namedConsoleColorBits(s.Fg)
+		if s.Bold {
+			attr |= foregroundIntensity
+		}
+	} else if s.Bold {
+		attr |= foregroundIntensity
+	}
+	if s.hasBg && s.Bg.kind == colorNamed {
+		attr = attr&^0x00f0 | namedConsoleColorBits(s.Bg)<<4
+	}
+	if s.Reverse {
+		attr |= commonLvbReverseVideo
+	}
+	return attr
+}
+
+func namedConsoleColorBits(c Color) uint16 {
+	if c.kind == colorNamed {
+		bits := namedConsoleColor[c.named%8]
+		if c.named >= BrightBlack {
+			// foregroundIntensity shifts onto backgroundIntensity for callers
+			// building the background nibble.
+			bits |= foregroundIntensity
+		}
+		return bits
+	}
+	return namedConsoleColor[White]
+}
+
+func (t *winTerminal) SetStyle(s Style) {
+	t.attr = styleToConsoleAttr(s)
+	procSetConsoleTextAttribute.Call(uintptr(t.handle), uintptr(t.attr))
+}
+
+func (t *winTerminal) HideCursor(hide bool) {
+	// TODO Use GetConsoleCursorInfo/SetConsoleCursorInfo to toggle the
+	// cursor's visibility; left as a no-op until someone can test it against
+	// a real console.
+}
+
+func (t *winTerminal) WriteRunes(rs ...rune) {
+	s := syscall.StringToUTF16(string(rs))
+	var written uint32
+	syscall.WriteConsole(t.handle, &s[0], uint32(len(s)-1), &written, nil)
+}
+
+func (t *winTerminal) Flush() error {
+	return nil
+}
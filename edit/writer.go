@@ -3,11 +3,10 @@ package edit
 import (
 	"os"
 	"fmt"
-	"bytes"
 	"strings"
+	"sync"
 	"unicode"
 	"unicode/utf8"
-	"./tty"
 	"../util"
 )
 
@@ -16,7 +15,7 @@ import (
 type cell struct {
 	rune
 	width byte
-	attr string
+	attr Style
 }
 
 // pos is the position within a buffer.
@@ -47,81 +46,196 @@ func (b *buffer) appendLine(w int) {
 // writer is the part of an Editor responsible for keeping the status of and
 // updating the screen.
 type writer struct {
-	file *os.File
+	term Terminal
+	// mu guards oldBuf, since it may be reset by Invalidate from a goroutine
+	// other than the one driving refresh/commitBuffer (e.g. a SIGWINCH
+	// handler).
+	mu sync.Mutex
 	oldBuf, buf *buffer
+	// hideCursorOnFlush controls whether the cursor is hidden for the
+	// duration of commitBuffer, to avoid it visibly jumping through
+	// intermediate positions while the buffer is being repainted. Tests and
+	// dumb terminals that do not understand the DEC private mode sequences
+	// can turn this off.
+	hideCursorOnFlush bool
 	// Fields below are used when refreshing.
 	width, indent int
 	cursor pos
 }
 
 func newWriter(f *os.File) *writer {
-	writer := &writer{file: f, oldBuf: newBuffer(0)}
+	writer := &writer{term: newTerminal(f), oldBuf: newBuffer(0), hideCursorOnFlush: true}
 	return writer
 }
 
 func (w *writer) startBuffer() {
-	fd := int(w.file.Fd())
-	w.width = int(tty.GetWinsize(fd).Col)
+	w.width = w.term.WindowWidth()
 	w.indent = 0
 	w.cursor = pos{}
 	w.buf = newBuffer(w.width)
 }
 
-// deltaPos calculates the escape sequence needed to move the cursor from one
-// position to another.
-func deltaPos(from, to pos) []byte {
-	buf := new(bytes.Buffer)
-	if from.line < to.line {
-		// move down
-		buf.WriteString(fmt.Sprintf("\033[%dB", to.line - from.line))
-	} else if from.line > to.line {
-		// move up
-		buf.WriteString(fmt.Sprintf("\033[%dA", from.line - to.line))
+// Invalidate discards the writer's record of what is currently on the
+// terminal, so that the next commitBuffer does a full redraw instead of a
+// delta against possibly-stale content -- e.g. after the terminal has been
+// resized underneath it. It is safe to call concurrently with refresh.
+func (w *writer) Invalidate() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	// Only the remembered line content is stale; the real terminal cursor is
+	// still wherever the last completed commitBuffer left it, and
+	// commitBuffer seeds its cursor tracking from oldBuf.dot and emits its
+	// line moves relative to that. Zeroing dot along with the cells would
+	// make it think the cursor is back at the buffer origin and corrupt the
+	// redraw.
+	w.oldBuf = &buffer{cells: [][]cell{{}}, dot: w.oldBuf.dot}
+}
+
+// lineEqual reports whether two lines have identical cells.
+func lineEqual(a, b []cell) bool {
+	if len(a) != len(b) {
+		return false
 	}
-	if from.col < to.col {
-		// move right
-		buf.WriteString(fmt.Sprintf("\033[%dC", to.col - from.col))
-	} else if from.col > to.col {
-		// move left
-		buf.WriteString(fmt.Sprintf("\033[%dD", from.col - to.col))
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
 	}
-	return buf.Bytes()
+	return true
 }
 
-// commitBuffer updates the terminal display to reflect current buffer.
-// TODO Instead of erasing w.oldBuf entirely and then draw w.buf, compute a
-// delta between w.oldBuf and w.buf
+// commitBuffer updates the terminal display to reflect current buffer,
+// writing only the cells that differ from w.oldBuf instead of erasing and
+// redrawing everything. Lines that are identical between the two buffers are
+// left untouched on the terminal. All screen updates go through w.term, so
+// this method knows nothing about the concrete escape sequences or console
+// calls that implies.
 func (w *writer) commitBuffer() error {
-	bytesBuf := new(bytes.Buffer)
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.hideCursorOnFlush {
+		w.term.HideCursor(true)
+	}
+
+	// cursor tracks the position w.term's cursor is actually at, so that
+	// moveTo only emits the moves that are actually needed.
+	cursor := w.oldBuf.dot
+	moveTo := func(p pos) {
+		if cursor.line != p.line {
+			w.term.MoveCursor(0, p.line - cursor.line)
+			cursor.line = p.line
+		}
+		if cursor.col != p.col {
+			w.term.MoveToColumn(p.col)
+			cursor.col = p.col
+		}
+	}
+	// writeLine writes the cells of line in [first, end), skipping the
+	// internal '\n' line-separator cell, which never reaches the terminal.
+	writeLine := func(line []cell, first, end int) {
+		for _, c := range line[first:end] {
+			if c.rune == '\n' {
+				continue
+			}
+			w.term.SetStyle(c.attr)
+			w.term.WriteRunes(c.rune)
+		}
+	}
 
-	pLine := w.oldBuf.dot.line
-	if pLine > 0 {
-		fmt.Fprintf(bytesBuf, "\033[%dA", pLine)
+	oldLines := w.oldBuf.cells
+	newLines := w.buf.cells
+	nCommon := len(oldLines)
+	if nCommon > len(newLines) {
+		nCommon = len(newLines)
 	}
-	bytesBuf.WriteString("\r\033[J")
-
-	attr := ""
-	for _, line := range w.buf.cells {
-		for _, c := range line {
-			if c.width > 0 && c.attr != attr {
-				fmt.Fprintf(bytesBuf, "\033[m\033[%sm", c.attr)
-				attr = c.attr
+
+	// Rewrite the part of the screen that already exists, repositioning the
+	// cursor rather than rewriting unchanged lines.
+	for i := 0; i < nCommon; i++ {
+		oldLine, newLine := oldLines[i], newLines[i]
+		if lineEqual(oldLine, newLine) {
+			continue
+		}
+
+		// Only the cells between the first divergence and the last one need
+		// rewriting; a common suffix (e.g. " world" in "hallo world" after
+		// "hello world") can be left alone just like a common prefix.
+		first := 0
+		for first < len(newLine) && first < len(oldLine) && newLine[first] == oldLine[first] {
+			first++
+		}
+
+		// The trailing run only lines up with the terminal's existing
+		// content when both lines are the same length -- if the line grew
+		// or shrank, the "unchanged" trailing cells would land in different
+		// columns, so fall back to rewriting through the end in that case.
+		last := 0
+		if len(newLine) == len(oldLine) {
+			for last < len(newLine)-first && newLine[len(newLine)-1-last] == oldLine[len(oldLine)-1-last] {
+				last++
 			}
-			bytesBuf.WriteString(string(c.rune))
+		}
+		changedEnd := len(newLine) - last
+
+		moveTo(pos{line: i, col: colOf(newLine[:first])})
+		writeLine(newLine, first, changedEnd)
+		cursor.col = colOf(newLine[:changedEnd])
+
+		if len(newLine) < len(oldLine) {
+			w.term.SetStyle(Style{})
+			w.term.ClearToEOL()
 		}
 	}
-	if attr != "" {
-		bytesBuf.WriteString("\033[m")
+
+	if len(newLines) > len(oldLines) {
+		// Grow the screen: move to the end of the last existing line and
+		// emit a real newline per extra row, since those rows do not yet
+		// exist on the terminal and cursor movement alone cannot create
+		// them.
+		if len(oldLines) > 0 {
+			last := oldLines[len(oldLines)-1]
+			moveTo(pos{line: len(oldLines) - 1, col: colOf(last)})
+		}
+		for i := len(oldLines); i < len(newLines); i++ {
+			w.term.WriteRunes('\r', '\n')
+			cursor = pos{line: i}
+			writeLine(newLines[i], 0, len(newLines[i]))
+			cursor.col = colOf(newLines[i])
+		}
+	} else if len(newLines) < len(oldLines) {
+		// Shrink the screen: clear everything from the end of the new
+		// content to the bottom of the old content.
+		moveTo(pos{line: len(newLines)})
+		w.term.SetStyle(Style{})
+		w.term.ClearToEOS()
 	}
-	bytesBuf.Write(deltaPos(w.cursor, w.buf.dot))
 
-	_, err := w.file.Write(bytesBuf.Bytes())
-	if err != nil {
-		return err
+	w.term.SetStyle(Style{})
+	moveTo(w.buf.dot)
+
+	if w.hideCursorOnFlush {
+		w.term.HideCursor(false)
 	}
 
 	w.oldBuf = w.buf
-	return nil
+	return w.term.Flush()
+}
+
+func maxInt(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+// colOf returns the terminal column reached after writing the given cells.
+func colOf(cells []cell) int {
+	col := 0
+	for _, c := range cells {
+		col += int(c.width)
+	}
+	return col
 }
 
 func (w *writer) appendToLine(c cell) {
@@ -143,7 +257,7 @@ func (w *writer) newline() {
 }
 
 // write appends a single rune to w.buf.
-func (w *writer) write(r rune, attr string) {
+func (w *writer) write(r rune, attr Style) {
 	if r == '\n' {
 		w.newline()
 		return
@@ -165,7 +279,7 @@ func (w *writer) write(r rune, attr string) {
 	}
 }
 
-func (w *writer) writes(s string, attr string) {
+func (w *writer) writes(s string, attr Style) {
 	for _, r := range s {
 		w.write(r, attr)
 	}
@@ -205,7 +319,7 @@ func (w *writer) refresh(bs *bufferState) error {
 				for _, part := range comp.candidates[comp.current].parts {
 					attr := attrForType[comp.typ]
 					if part.completed {
-						attr += attrForCompleted
+						attr = attr.Merge(attrForCompleted)
 					}
 					w.writes(part.text, attr)
 				}
@@ -220,7 +334,7 @@ func (w *writer) refresh(bs *bufferState) error {
 	// Write rprompt
 	padding := w.width - 1 - w.cursor.col - wcwidths(bs.rprompt)
 	if padding >= 1 {
-		w.writes(strings.Repeat(" ", padding), "")
+		w.writes(strings.Repeat(" ", padding), Style{})
 		w.writes(bs.rprompt, attrForRprompt)
 	}
 
@@ -242,42 +356,133 @@ func (w *writer) refresh(bs *bufferState) error {
 	}
 
 	if comp != nil {
-		// Layout candidates in multiple columns
+		// Layout candidates in multiple columns, reserving a second column
+		// per candidate for its description if any candidate has one.
 		cands := comp.candidates
 
-		// First decide the shape (# of rows and columns)
-		colWidth := 0
-		colMargin := 2
+		colWidth, hasDesc := 0, false
 		for _, cand := range cands {
-			width := wcwidths(cand.text)
-			if colWidth < width {
+			if width := wcwidths(cand.text); colWidth < width {
 				colWidth = width
 			}
+			if cand.description != "" {
+				hasDesc = true
+			}
+		}
+		colMargin := 2
+		descWidth := 0
+		if hasDesc {
+			descWidth = w.width / 3
 		}
 
-		cols := (w.width + colMargin) / (colWidth + colMargin)
+		cols := (w.width + colMargin) / (colWidth + descWidth + colMargin)
 		if cols == 0 {
 			cols = 1
 		}
 		lines := util.CeilDiv(len(cands), cols)
 
-		for i := 0; i < lines; i++ {
+		// Cap the visible region to what is left of the terminal below the
+		// prompt/mode/tip lines already written, and scroll the window as
+		// comp.current moves past its top or bottom instead of dumping every
+		// candidate regardless of terminal height.
+		maxRows := w.term.WindowHeight() - w.cursor.line - 1
+		if maxRows < 1 {
+			maxRows = 1
+		}
+		visibleRows := lines
+		if visibleRows > maxRows {
+			// Scrolling may need to show both a "↑ N more" row above the
+			// window and a "↓ N more" row below it at once, so reserve 2
+			// of the maxRows rows for indicators here (the 1 taken off
+			// maxRows above is the line the cursor is already on, not an
+			// indicator row); reserving only 1 let the menu grow one row
+			// past maxRows whenever comp.current sat strictly inside the
+			// page.
+			indicatorRows := 2
+			if maxRows <= indicatorRows {
+				indicatorRows = maxRows - 1
+			}
+			visibleRows = maxRows - indicatorRows
+			if visibleRows < 1 {
+				visibleRows = 1
+			}
+		}
+		if visibleRows < lines {
+			row := 0
+			if comp.current >= 0 {
+				row = comp.current % lines
+			}
+			if row < comp.scroll {
+				comp.scroll = row
+			} else if row >= comp.scroll+visibleRows {
+				comp.scroll = row - visibleRows + 1
+			}
+			if comp.scroll > lines-visibleRows {
+				comp.scroll = lines - visibleRows
+			}
+		} else {
+			comp.scroll = 0
+		}
+
+		// The indicator rows are themselves part of the row budget: if both
+		// an "above" and a "below" indicator are needed but only one row is
+		// left once visibleRows is accounted for, showing both anyway would
+		// push the menu past maxRows. Merge them onto a single line instead,
+		// and drop indicators altogether if there is no budget left at all
+		// (possible only when maxRows is 1).
+		indicatorBudget := maxRows - visibleRows
+		hasAbove := comp.scroll > 0
+		rowsBelow := lines - comp.scroll - visibleRows
+		hasBelow := rowsBelow > 0
+		// Candidates are laid out column-major (candidate k sits on row
+		// k % lines), so count the hidden ones by row.
+		above, below := 0, 0
+		for k := range cands {
+			if row := k % lines; row < comp.scroll {
+				above++
+			} else if row >= comp.scroll+visibleRows {
+				below++
+			}
+		}
+
+		combine := hasAbove && hasBelow && indicatorBudget < 2
+
+		if hasAbove && !combine && indicatorBudget >= 1 {
+			w.newline()
+			w.writes(fmt.Sprintf("↑ %d more", above), attrForTip)
+		}
+
+		for i := comp.scroll; i < comp.scroll+visibleRows; i++ {
 			w.newline()
 			for j := 0; j < cols; j++ {
 				k := j * lines + i
 				if k >= len(cands) {
 					continue
 				}
-				var attr string
+				var attr Style
 				if k == comp.current {
 					attr = attrForCurrentCompletion
 				}
 				text := cands[k].text
 				w.writes(text, attr)
 				w.writes(strings.Repeat(" ", colWidth - wcwidths(text)), attr)
-				w.writes(strings.Repeat(" ", colMargin), "")
+				if hasDesc {
+					desc := cands[k].description
+					w.writes(desc, Style{Dim: true}.Merge(attr))
+					w.writes(strings.Repeat(" ", maxInt(0, descWidth - wcwidths(desc))), attr)
+				}
+				w.writes(strings.Repeat(" ", colMargin), Style{})
 			}
 		}
+
+		switch {
+		case combine && indicatorBudget >= 1:
+			w.newline()
+			w.writes(fmt.Sprintf("↑ %d · ↓ %d more", above, below), attrForTip)
+		case hasBelow && !combine && indicatorBudget >= 1:
+			w.newline()
+			w.writes(fmt.Sprintf("↓ %d more", below), attrForTip)
+		}
 	}
 
 	return w.commitBuffer()